@@ -0,0 +1,36 @@
+package pllb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// chain builds an independent State chain of n AddEnv calls, rooted at an
+// image reference so Marshal has something to walk.
+func chain(ref string, n int) State {
+	st := Image(ref)
+	for i := 0; i < n; i++ {
+		st = st.AddEnv(fmt.Sprintf("VAR_%d", i), "value")
+	}
+	return st
+}
+
+// BenchmarkMarshalConcurrent marshals many independent chains in parallel.
+// gmu currently serializes every wrapper method, so this does not scale with
+// GOMAXPROCS yet - it exists as a baseline for whenever the locking is
+// narrowed to just the llb calls that need it, with a go test -race case
+// (TestMarshalConcurrentSharedBase) proving that's actually safe first.
+func BenchmarkMarshalConcurrent(b *testing.B) {
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			st := chain(fmt.Sprintf("docker.io/library/image-%d", i), 50)
+			if _, err := st.Marshal(ctx); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
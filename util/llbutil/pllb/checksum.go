@@ -0,0 +1,139 @@
+package pllb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// maxChecksumWorkers bounds the number of files hashed concurrently, so that
+// very large include sets don't open an unbounded number of file descriptors.
+const maxChecksumWorkers = 8
+
+// contentChecksum computes a content-addressed digest for name and the
+// expanded set of incl patterns. Unlike an inode-based hint, this is stable
+// across filesystems, bind mounts and CI runners, since it is derived from
+// the actual file contents (with mode mixed in) rather than filesystem
+// metadata that the OS is free to reassign.
+func contentChecksum(name string, incl []string) (string, error) {
+	paths, err := expandIncludePatterns(incl)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 && len(incl) != 0 {
+		// None of incl resolved to a file - most likely because the
+		// patterns don't resolve against this process's cwd (see
+		// expandIncludePatterns). Hashing zero files would collapse the
+		// SharedKeyHint down to a hash of name alone, colliding with every
+		// other WithInclude call for this name regardless of incl or file
+		// contents, so surface this as an error instead and let the caller
+		// fall back to the inode-based hash.
+		return "", fmt.Errorf("no files matched include patterns %v for %q", incl, name)
+	}
+	sort.Strings(paths)
+
+	digests := make([][]byte, len(paths))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxChecksumWorkers)
+	var mu sync.Mutex
+	var firstErr error
+	for i, p := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d, err := hashFile(p)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			digests[i] = d
+		}(i, p)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	h := sha256.New()
+	h.Write([]byte(name))
+	for i, p := range paths {
+		h.Write([]byte(p))
+		h.Write(digests[i])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile mixes a file's mode and (for regular files) its contents into a
+// sha256 digest.
+func hashFile(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(info.Mode()))
+	h.Write(b)
+
+	if info.Mode().IsRegular() {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// expandIncludePatterns expands incl (after fixIncl normalization) into a
+// deduplicated list of file paths, walking any matched directories. Patterns
+// are resolved against the process's current working directory, not name -
+// the same convention the inode-based hash this replaces relied on, since
+// name is the local mount's declared name rather than a filesystem path we
+// can join against.
+func expandIncludePatterns(incl []string) ([]string, error) {
+	seen := map[string]struct{}{}
+	var out []string
+	for _, pattern := range incl {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			err := filepath.Walk(m, func(p string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if fi.IsDir() {
+					return nil
+				}
+				if _, ok := seen[p]; ok {
+					return nil
+				}
+				seen[p] = struct{}{}
+				out = append(out, p)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package pllb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixIncl(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"dot", []string{"."}, []string{"./*"}},
+		{"dir-dot", []string{"foo/."}, []string{"foo/*"}},
+		{"passthrough", []string{"foo/bar"}, []string{"foo/bar"}},
+		{"mixed", []string{".", "baz"}, []string{"./*", "baz"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := fixIncl(c.in)
+			if len(got) != len(c.want) {
+				t.Fatalf("fixIncl(%v) = %v, want %v", c.in, got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("fixIncl(%v) = %v, want %v", c.in, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandIncludePatterns(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "a.txt"), "a")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(dir, "sub", "b.txt"), "b")
+
+	got, err := expandIncludePatterns([]string{filepath.Join(dir, "*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expandIncludePatterns() = %v, want 2 files", got)
+	}
+}
+
+func TestExpandIncludePatternsNoMatch(t *testing.T) {
+	got, err := expandIncludePatterns([]string{filepath.Join(t.TempDir(), "does-not-exist-*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expandIncludePatterns() = %v, want no matches", got)
+	}
+}
+
+func TestContentChecksumNoMatchIsError(t *testing.T) {
+	// A pattern that matches nothing must be an error, not a success with
+	// zero entropy - otherwise the resulting SharedKeyHint collapses to a
+	// hash of name alone and collides across unrelated WithInclude calls.
+	_, err := contentChecksum("myname", []string{filepath.Join(t.TempDir(), "does-not-exist-*")})
+	if err == nil {
+		t.Fatal("expected an error when no include pattern matches any file")
+	}
+}
+
+func TestContentChecksumStableAndDistinct(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "a.txt"), "hello")
+	incl := []string{filepath.Join(dir, "*")}
+
+	k1, err := contentChecksum("name", incl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := contentChecksum("name", incl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 != k2 {
+		t.Fatalf("contentChecksum not stable across calls: %q != %q", k1, k2)
+	}
+
+	write(t, filepath.Join(dir, "a.txt"), "world")
+	k3, err := contentChecksum("name", incl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 == k3 {
+		t.Fatal("contentChecksum did not change when file contents changed")
+	}
+}
+
+func TestGetSharedKeyHintFromIncludeFastHashFallback(t *testing.T) {
+	t.Setenv("PLLB_FAST_HASH", "1")
+	// PLLB_FAST_HASH must always return a key, even for patterns that match
+	// nothing on this machine.
+	if got := getSharedKeyHintFromInclude("name", []string{filepath.Join(t.TempDir(), "missing-*")}); got == "" {
+		t.Fatal("getSharedKeyHintFromInclude returned an empty key")
+	}
+}
+
+func write(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
-	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -53,6 +52,7 @@ func Scratch() State {
 
 // Local is a wrapper around llb.Local.
 func Local(name string, opts ...llb.LocalOption) State {
+	getTracer().OnLocalCreated(name, opts)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return State{
@@ -104,8 +104,13 @@ func (s State) SetMarshalDefaults(co ...llb.ConstraintsOpt) State {
 // Marshal is a wrapper around llb.Marshal.
 func (s State) Marshal(ctx context.Context, co ...llb.ConstraintsOpt) (*llb.Definition, error) {
 	gmu.Lock()
-	defer gmu.Unlock()
-	return s.st.Marshal(ctx, co...)
+	def, err := s.st.Marshal(ctx, co...)
+	gmu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	getTracer().OnMarshal(len(def.Def))
+	return def, nil
 }
 
 // Run is a wrapper around llb.Run.
@@ -143,7 +148,21 @@ func (s State) GetDir(ctx context.Context) (string, error) {
 	return s.st.GetDir(ctx)
 }
 
+// getSharedKeyHintFromInclude derives a SharedKeyHint from the contents of
+// name and incl, so that identical source trees hash to the same key
+// regardless of the machine they were built on. Set PLLB_FAST_HASH=1 to fall
+// back to the old inode-based hash for very large contexts, where hashing
+// every file's contents would be too slow.
 func getSharedKeyHintFromInclude(name string, incl []string) string {
+	if os.Getenv("PLLB_FAST_HASH") != "1" {
+		key, err := contentChecksum(name, incl)
+		if err == nil {
+			return key
+		}
+		// fall through to the inode-based hash, e.g. because incl
+		// references paths that aren't materialized on this machine.
+	}
+
 	h := sha1.New()
 	b := make([]byte, 8)
 
@@ -175,27 +194,29 @@ func fixIncl(incl []string) []string {
 }
 
 // WithInclude creates a new local state with include patterns set
-// this is to prevent copying the entire directory contents.
+// this is to prevent copying the entire directory contents. The
+// SharedKeyHint is content-derived (see getSharedKeyHintFromInclude), so the
+// cache key - and withincludCache - stay stable across machines.
 func (s State) WithInclude(incl []string) State {
 	gmu.Lock()
 	defer gmu.Unlock()
 
-	fmt.Printf("%q incl %d  elems: %v\n", s.localName, len(incl), incl)
-
 	if s.localName == "" {
 		// state is not local, don't modify it.
 		return s
 	}
 
 	incl = fixIncl(incl)
-	fmt.Printf("after fix: %v\n", incl)
 
 	key := getSharedKeyHintFromInclude(s.localName, incl)
 	if st, ok := withincludCache[key]; ok {
-		fmt.Printf("re-using cache for %q -> %q %v\n", key, s.localName, incl)
+		getTracer().OnIncludeCacheHit(key, s.localName, incl)
 		return st
 	}
 
+	hashInputs, _ := expandIncludePatterns(incl)
+	getTracer().OnIncludeCacheMiss(key, s.localName, incl, hashInputs)
+
 	opts := []llb.LocalOption{}
 	for _, o := range s.localOpts {
 		opts = append(opts, o)
@@ -203,9 +224,7 @@ func (s State) WithInclude(incl []string) State {
 	opts = append(opts, llb.IncludePatterns(incl))
 	opts = append(opts, llb.SharedKeyHint(key))
 
-	fmt.Printf("caching %q\n", key)
 	st := State{st: llb.Local(s.localName, opts...)}
-	fmt.Printf("saving to cache for %q -> %q %v\n", key, s.localName, incl)
 	withincludCache[key] = st
 	return st
 }
@@ -257,6 +276,7 @@ type FileAction struct {
 
 // Mkdir is a wrapper around llb.Mkdir.
 func (fa *FileAction) Mkdir(p string, m os.FileMode, opt ...llb.MkdirOption) *FileAction {
+	getTracer().OnFileAction("mkdir", p)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: fa.fia.Mkdir(p, m, opt...)}
@@ -264,6 +284,7 @@ func (fa *FileAction) Mkdir(p string, m os.FileMode, opt ...llb.MkdirOption) *Fi
 
 // Mkfile is a wrapper around llb.Mkfile.
 func (fa *FileAction) Mkfile(p string, m os.FileMode, dt []byte, opt ...llb.MkfileOption) *FileAction {
+	getTracer().OnFileAction("mkfile", p)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: fa.fia.Mkfile(p, m, dt, opt...)}
@@ -271,6 +292,7 @@ func (fa *FileAction) Mkfile(p string, m os.FileMode, dt []byte, opt ...llb.Mkfi
 
 // Rm is a wrapper around llb.Rm.
 func (fa *FileAction) Rm(p string, opt ...llb.RmOption) *FileAction {
+	getTracer().OnFileAction("rm", p)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: fa.fia.Rm(p, opt...)}
@@ -278,6 +300,7 @@ func (fa *FileAction) Rm(p string, opt ...llb.RmOption) *FileAction {
 
 // Copy is a wrapper around llb.Copy.
 func (fa *FileAction) Copy(input CopyInput, src, dest string, opt ...llb.CopyOption) *FileAction {
+	getTracer().OnFileAction("copy", dest)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: fa.fia.Copy(input.UnsafeUnwrap(), src, dest, opt...)}
@@ -285,6 +308,7 @@ func (fa *FileAction) Copy(input CopyInput, src, dest string, opt ...llb.CopyOpt
 
 // Mkdir is a wrapper around llb.Mkdir.
 func Mkdir(p string, m os.FileMode, opt ...llb.MkdirOption) *FileAction {
+	getTracer().OnFileAction("mkdir", p)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: llb.Mkdir(p, m, opt...)}
@@ -292,6 +316,7 @@ func Mkdir(p string, m os.FileMode, opt ...llb.MkdirOption) *FileAction {
 
 // Mkfile is a wrapper around llb.Mkfile.
 func Mkfile(p string, m os.FileMode, dt []byte, opts ...llb.MkfileOption) *FileAction {
+	getTracer().OnFileAction("mkfile", p)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: llb.Mkfile(p, m, dt, opts...)}
@@ -299,6 +324,7 @@ func Mkfile(p string, m os.FileMode, dt []byte, opts ...llb.MkfileOption) *FileA
 
 // Copy is a wrapper around llb.Copy.
 func Copy(input CopyInput, src, dest string, opts ...llb.CopyOption) *FileAction {
+	getTracer().OnFileAction("copy", dest)
 	gmu.Lock()
 	defer gmu.Unlock()
 	return &FileAction{fia: llb.Copy(input.UnsafeUnwrap(), src, dest, opts...)}
@@ -0,0 +1,38 @@
+package pllb
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// TestMarshalConcurrentSharedBase marshals two states derived from the same
+// base state concurrently - the overlapping-graph scenario (e.g. two targets
+// FROM the same base image) that a throughput benchmark over independent
+// chains can't exercise. Run with -race before relaxing gmu around Marshal
+// or any other wrapper method.
+func TestMarshalConcurrentSharedBase(t *testing.T) {
+	base := Image("docker.io/library/alpine")
+	a := base.AddEnv("A", "1")
+	b := base.AddEnv("B", "2")
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, st := range []State{a, b} {
+		wg.Add(1)
+		go func(st State) {
+			defer wg.Done()
+			_, err := st.Marshal(ctx)
+			errs <- err
+		}(st)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
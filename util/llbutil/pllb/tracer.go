@@ -0,0 +1,64 @@
+package pllb
+
+import (
+	"sync/atomic"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+// Tracer receives structured events from pllb, in place of the fmt.Printf
+// debug lines WithInclude used to emit. Implementations must be safe for
+// concurrent use, since pllb itself is used concurrently.
+type Tracer interface {
+	// OnLocalCreated is called whenever Local creates a new local state. The
+	// local states that WithInclude creates are reported through
+	// OnIncludeCacheMiss only, not through OnLocalCreated.
+	OnLocalCreated(name string, opts []llb.LocalOption)
+	// OnIncludeCacheHit is called when WithInclude finds an existing local
+	// state for key in withincludCache.
+	OnIncludeCacheHit(key, name string, incl []string)
+	// OnIncludeCacheMiss is called when WithInclude has to create a new
+	// local state. hashInputs is the expanded list of files matched by incl,
+	// for diagnosing unexpected re-uploads; these are the files the
+	// content-based SharedKeyHint hashes, and are reported even when the key
+	// came from the inode-based fallback instead.
+	OnIncludeCacheMiss(key, name string, incl []string, hashInputs []string)
+	// OnMarshal is called after a successful State.Marshal, with the number
+	// of vertices in the resulting definition.
+	OnMarshal(defSize int)
+	// OnFileAction is called for every FileAction operation (kind is one of
+	// "mkdir", "mkfile", "rm" or "copy"), with the path it operates on.
+	OnFileAction(kind string, path string)
+}
+
+// noopTracer is the default Tracer: it does nothing.
+type noopTracer struct{}
+
+func (noopTracer) OnLocalCreated(string, []llb.LocalOption)              {}
+func (noopTracer) OnIncludeCacheHit(string, string, []string)            {}
+func (noopTracer) OnIncludeCacheMiss(string, string, []string, []string) {}
+func (noopTracer) OnMarshal(int)                                         {}
+func (noopTracer) OnFileAction(string, string)                           {}
+
+// tracer holds the active Tracer, boxed behind a *Tracer so every Store call
+// sees the same concrete type regardless of which Tracer implementation is
+// installed - atomic.Value panics if that type ever changes between calls.
+var tracer atomic.Value
+
+func init() {
+	var t Tracer = noopTracer{}
+	tracer.Store(&t)
+}
+
+// SetTracer installs t as the active Tracer for all subsequent pllb calls.
+// Passing nil restores the default no-op Tracer.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracer.Store(&t)
+}
+
+func getTracer() Tracer {
+	return *tracer.Load().(*Tracer)
+}
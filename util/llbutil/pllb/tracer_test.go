@@ -0,0 +1,37 @@
+package pllb
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+// fakeTracer is a second Tracer implementation distinct from noopTracer, so
+// SetTracer exercises the boxing-behind-*Tracer path that prevents
+// atomic.Value's "inconsistently typed value" panic.
+type fakeTracer struct {
+	onLocalCreated int
+}
+
+func (f *fakeTracer) OnLocalCreated(string, []llb.LocalOption)              { f.onLocalCreated++ }
+func (f *fakeTracer) OnIncludeCacheHit(string, string, []string)            {}
+func (f *fakeTracer) OnIncludeCacheMiss(string, string, []string, []string) {}
+func (f *fakeTracer) OnMarshal(int)                                         {}
+func (f *fakeTracer) OnFileAction(string, string)                           {}
+
+func TestSetTracerAcrossConcreteTypes(t *testing.T) {
+	t.Cleanup(func() { SetTracer(nil) })
+
+	// Default Tracer is the no-op; calling it must not panic.
+	getTracer().OnMarshal(0)
+
+	f := &fakeTracer{}
+	SetTracer(f)
+	getTracer().OnFileAction("mkdir", "/tmp")
+
+	// Switching back to nil restores the no-op without panicking, even
+	// though the concrete type stored changes from *fakeTracer to
+	// noopTracer.
+	SetTracer(nil)
+	getTracer().OnMarshal(0)
+}